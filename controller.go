@@ -0,0 +1,90 @@
+package main
+
+import "math"
+
+// Controller abstracts a source of stick axis values so updateCtrl can read
+// from whichever input scheme is active without caring how the values were
+// produced.
+type Controller interface {
+	PollAxes() (rx, ry, lx, ly float64)
+}
+
+type accelController struct {
+	roll, pitch   float64
+	yaw, throttle float64
+}
+
+func (a *accelController) PollAxes() (rx, ry, lx, ly float64) {
+	return a.roll, a.pitch, a.yaw, a.throttle
+}
+
+type touchController struct{}
+
+func (touchController) PollAxes() (rx, ry, lx, ly float64) {
+	return rightStick.x, rightStick.y, leftStick.x, leftStick.y
+}
+
+const (
+	axisRx = iota
+	axisRy
+	axisLx
+	axisLy
+	numAxes
+)
+
+const gamepadDeadzone = 0.12
+
+// gamepadController reads stick input surfaced from a Bluetooth gamepad via
+// Android's InputDevice MotionEvent axes. There's no gomobile event type for
+// that today, so a platform-side JNI bridge (not part of this tree) is
+// expected to call SetAxis as axis values arrive. Until that bridge exists,
+// nothing in this tree calls SetAxis: this is scaffolding for modeGamepad,
+// not a reachable feature yet.
+type gamepadController struct {
+	axes      [numAxes]float64
+	seen      [numAxes]bool
+	connected bool
+}
+
+// SetAxis records a raw axis reading. The first reading for a given axis is
+// dropped rather than trusted: a just-connected pad emits a MotionEvent with
+// 0 for trigger axes before any real input, and treating that as real would
+// snap the stick to center. connected latches on the first reading of any
+// axis, since that's the only signal this tree has that a platform-side
+// bridge is actually calling in; nothing calls SetAxis yet, so connected
+// stays false and toggleMode skips modeGamepad until a bridge exists.
+func (g *gamepadController) SetAxis(axis int, val float64) {
+	g.connected = true
+	if !g.seen[axis] {
+		g.seen[axis] = true
+		return
+	}
+	g.axes[axis] = deadzone(val, gamepadDeadzone)
+}
+
+func (g *gamepadController) PollAxes() (rx, ry, lx, ly float64) {
+	return g.axes[axisRx], g.axes[axisRy], g.axes[axisLx], g.axes[axisLy]
+}
+
+func deadzone(val, dz float64) float64 {
+	if math.Abs(val) < dz {
+		return 0.0
+	}
+	return val
+}
+
+var (
+	accelCtl   = &accelController{}
+	touchCtl   = touchController{}
+	gamepadCtl = &gamepadController{}
+
+	controllers = map[controlMode]Controller{
+		modeTilt:    accelCtl,
+		modeTouch:   touchCtl,
+		modeGamepad: gamepadCtl,
+	}
+)
+
+func activeController() Controller {
+	return controllers[activeMode]
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SMerrony/tello"
+	"golang.org/x/mobile/exp/f32"
+	"golang.org/x/mobile/exp/gl/glutil"
+	"golang.org/x/mobile/gl"
+)
+
+const hudVertShader = `#version 100
+
+attribute vec4 hudPosition;
+attribute vec2 hudTexCoord;
+varying vec2 vHudTexCoord;
+
+void main() {
+	vHudTexCoord = hudTexCoord;
+	gl_Position = hudPosition;
+}`
+
+const hudFragShader = `#version 100
+
+uniform sampler2D glyphTex;
+uniform mediump vec3 hudColor;
+varying vec2 vHudTexCoord;
+
+void main() {
+	mediump float a = texture2D(glyphTex, vHudTexCoord).a;
+	gl_FragColor = vec4(hudColor, a);
+}`
+
+// glyphChars is the fixed, ordered set of characters baked into the atlas.
+// Index into this string gives a glyph's cell position.
+const glyphChars = "0123456789%:. ABDEFILMPSTW"
+
+const (
+	glyphCols   = 3
+	glyphRows   = 5
+	glyphCellW  = glyphCols + 1 // 1px padding column
+	glyphCellH  = glyphRows + 1 // 1px padding row
+	glyphAtlasW = len(glyphChars) * glyphCellW
+	glyphAtlasH = glyphCellH
+
+	glyphScale    = 3.0
+	glyphAdvanceW = (glyphCols + 1) * glyphScale
+	glyphLineH    = glyphRows*glyphScale + 4
+)
+
+// glyphBitmap holds a 3x5 bitmap per glyph, one byte per row with bit 2 as
+// the leftmost column.
+var glyphBitmap = map[byte][glyphRows]byte{
+	'0': {0x7, 0x5, 0x5, 0x5, 0x7},
+	'1': {0x2, 0x6, 0x2, 0x2, 0x7},
+	'2': {0x7, 0x1, 0x7, 0x4, 0x7},
+	'3': {0x7, 0x1, 0x7, 0x1, 0x7},
+	'4': {0x5, 0x5, 0x7, 0x1, 0x1},
+	'5': {0x7, 0x4, 0x7, 0x1, 0x7},
+	'6': {0x7, 0x4, 0x7, 0x5, 0x7},
+	'7': {0x7, 0x1, 0x2, 0x2, 0x2},
+	'8': {0x7, 0x5, 0x7, 0x5, 0x7},
+	'9': {0x7, 0x5, 0x7, 0x1, 0x7},
+	'%': {0x5, 0x1, 0x2, 0x4, 0x5},
+	':': {0x0, 0x2, 0x0, 0x2, 0x0},
+	'.': {0x0, 0x0, 0x0, 0x0, 0x2},
+	' ': {0x0, 0x0, 0x0, 0x0, 0x0},
+	'A': {0x7, 0x5, 0x7, 0x5, 0x5},
+	'B': {0x6, 0x5, 0x6, 0x5, 0x6},
+	'D': {0x6, 0x5, 0x5, 0x5, 0x6},
+	'E': {0x7, 0x4, 0x6, 0x4, 0x7},
+	'F': {0x7, 0x4, 0x6, 0x4, 0x4},
+	'I': {0x7, 0x2, 0x2, 0x2, 0x7},
+	'L': {0x4, 0x4, 0x4, 0x4, 0x7},
+	'M': {0x5, 0x7, 0x7, 0x5, 0x5},
+	'P': {0x7, 0x5, 0x7, 0x4, 0x4},
+	'S': {0x7, 0x4, 0x7, 0x1, 0x7},
+	'T': {0x7, 0x2, 0x2, 0x2, 0x2},
+	'W': {0x5, 0x5, 0x5, 0x7, 0x5},
+}
+
+var (
+	hudProgram      gl.Program
+	hudPosition     gl.Attrib
+	hudTexCoord     gl.Attrib
+	hudTexUniform   gl.Uniform
+	hudColorUniform gl.Uniform
+	hudVertBuf      gl.Buffer
+	hudTexCoordBuf  gl.Buffer
+	glyphTex        gl.Texture
+
+	flightDataMu    sync.Mutex
+	telemetryTicker *time.Ticker
+	telemetryStop   chan struct{}
+)
+
+func glyphCellIndex(ch byte) (int, bool) {
+	idx := strings.IndexByte(glyphChars, ch)
+	return idx, idx >= 0
+}
+
+func buildGlyphAtlas() []byte {
+	pix := make([]byte, glyphAtlasW*glyphAtlasH)
+	for i := 0; i < len(glyphChars); i++ {
+		rows := glyphBitmap[glyphChars[i]]
+		for r := 0; r < glyphRows; r++ {
+			for c := 0; c < glyphCols; c++ {
+				if rows[r]&(1<<uint(glyphCols-1-c)) != 0 {
+					pix[r*glyphAtlasW+i*glyphCellW+c] = 0xff
+				}
+			}
+		}
+	}
+	return pix
+}
+
+func getFlightData() tello.FlightData {
+	flightDataMu.Lock()
+	defer flightDataMu.Unlock()
+	return flightData
+}
+
+func setFlightData(fd tello.FlightData) {
+	flightDataMu.Lock()
+	flightData = fd
+	flightDataMu.Unlock()
+}
+
+// startHUD wires up the glyph-atlas text pipeline and starts sampling
+// telemetry on a ticker rather than piggy-backing on the accelerometer
+// callback.
+func startHUD() {
+	var err error
+	hudProgram, err = glutil.CreateProgram(glctx, hudVertShader, hudFragShader)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	hudVertBuf = glctx.CreateBuffer()
+	hudTexCoordBuf = glctx.CreateBuffer()
+	hudPosition = glctx.GetAttribLocation(hudProgram, "hudPosition")
+	hudTexCoord = glctx.GetAttribLocation(hudProgram, "hudTexCoord")
+	hudTexUniform = glctx.GetUniformLocation(hudProgram, "glyphTex")
+	hudColorUniform = glctx.GetUniformLocation(hudProgram, "hudColor")
+
+	glyphTex = glctx.CreateTexture()
+	glctx.BindTexture(gl.TEXTURE_2D, glyphTex)
+	glctx.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	glctx.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	glctx.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	glctx.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	glctx.TexImage2D(gl.TEXTURE_2D, 0, gl.ALPHA, glyphAtlasW, glyphAtlasH, gl.ALPHA, gl.UNSIGNED_BYTE, buildGlyphAtlas())
+
+	telemetryTicker = time.NewTicker(200 * time.Millisecond)
+	telemetryStop = make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-telemetryStop:
+				return
+			case <-telemetryTicker.C:
+				setFlightData(drone.GetFlightData())
+			}
+		}
+	}()
+}
+
+func stopHUD() {
+	if telemetryStop == nil {
+		return // startHUD never got past program setup
+	}
+	telemetryTicker.Stop()
+	close(telemetryStop)
+	telemetryStop = nil
+	glctx.DeleteProgram(hudProgram)
+	glctx.DeleteBuffer(hudVertBuf)
+	glctx.DeleteBuffer(hudTexCoordBuf)
+	glctx.DeleteTexture(glyphTex)
+}
+
+// drawText is a small immediate-mode text API: it draws s one glyph quad at
+// a time starting at the pixel coordinate (x, y), top-left anchored.
+func drawText(x, y float64, s string) {
+	if appSize.WidthPx < 2 || appSize.HeightPx < 2 {
+		return
+	}
+	glctx.Enable(gl.BLEND)
+	glctx.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	glctx.UseProgram(hudProgram)
+	glctx.ActiveTexture(gl.TEXTURE0)
+	glctx.BindTexture(gl.TEXTURE_2D, glyphTex)
+	glctx.Uniform1i(hudTexUniform, 0)
+	glctx.Uniform3f(hudColorUniform, 1.0, 1.0, 1.0)
+
+	cx := x
+	for i := 0; i < len(s); i++ {
+		if idx, ok := glyphCellIndex(s[i]); ok {
+			drawGlyphQuad(cx, y, idx)
+		}
+		cx += glyphAdvanceW
+	}
+
+	glctx.Disable(gl.BLEND)
+}
+
+func drawGlyphQuad(px, py float64, idx int) {
+	w := float64(glyphCols) * glyphScale
+	h := float64(glyphRows) * glyphScale
+	x0, x1 := pxToNDCx(px), pxToNDCx(px+w)
+	y0, y1 := pxToNDCy(py), pxToNDCy(py+h)
+	verts := f32.Bytes(binary.LittleEndian,
+		x0, y1, 0.0,
+		x1, y1, 0.0,
+		x0, y0, 0.0,
+		x1, y0, 0.0,
+	)
+	u0 := float32(idx*glyphCellW) / float32(glyphAtlasW)
+	u1 := float32(idx*glyphCellW+glyphCols) / float32(glyphAtlasW)
+	v0 := float32(0.0)
+	v1 := float32(glyphRows) / float32(glyphAtlasH)
+	texCoords := f32.Bytes(binary.LittleEndian,
+		u0, v1,
+		u1, v1,
+		u0, v0,
+		u1, v0,
+	)
+
+	glctx.BindBuffer(gl.ARRAY_BUFFER, hudVertBuf)
+	glctx.BufferData(gl.ARRAY_BUFFER, verts, gl.DYNAMIC_DRAW)
+	glctx.EnableVertexAttribArray(hudPosition)
+	glctx.VertexAttribPointer(hudPosition, 3, gl.FLOAT, false, 0, 0)
+	glctx.BindBuffer(gl.ARRAY_BUFFER, hudTexCoordBuf)
+	glctx.BufferData(gl.ARRAY_BUFFER, texCoords, gl.DYNAMIC_DRAW)
+	glctx.EnableVertexAttribArray(hudTexCoord)
+	glctx.VertexAttribPointer(hudTexCoord, 2, gl.FLOAT, false, 0, 0)
+	glctx.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+	glctx.DisableVertexAttribArray(hudPosition)
+	glctx.DisableVertexAttribArray(hudTexCoord)
+}
+
+func pxToNDCx(px float64) float32 {
+	return float32(2.0*px/float64(appSize.WidthPx-1) - 1.0)
+}
+
+func pxToNDCy(py float64) float32 {
+	return float32(1.0 - 2.0*py/float64(appSize.HeightPx-1))
+}
+
+// drawHUD renders battery, altitude, speed, wifi strength and flight time
+// from the latest ticker-sampled telemetry into the screen corners.
+func drawHUD() {
+	if appSize.WidthPx < 2 || appSize.HeightPx < 2 {
+		return
+	}
+	fd := getFlightData()
+	const margin = 8.0
+
+	drawText(margin, margin, fmt.Sprintf("BAT %d%%", fd.BatteryPercentage))
+	drawText(margin, margin+glyphLineH, fmt.Sprintf("ALT %.1fM", float64(fd.Height)/10.0))
+
+	speed := math.Hypot(float64(fd.NorthSpeed), float64(fd.EastSpeed)) / 10.0
+	bottomY := float64(appSize.HeightPx) - margin - glyphLineH
+	drawText(margin, bottomY, fmt.Sprintf("SPD %.1f", speed))
+	drawText(margin, bottomY+glyphLineH, fmt.Sprintf("TIME %d:%02d", fd.FlyTime/60, fd.FlyTime%60))
+
+	wifiText := fmt.Sprintf("WIFI %d", fd.WifiStrength)
+	drawText(float64(appSize.WidthPx)-margin-float64(len(wifiText))*glyphAdvanceW, margin, wifiText)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/SMerrony/tello"
+	"github.com/ianremmler/tellophone/flightrec"
+)
+
+const recordPath = "tellophone.rec"
+
+var replayFlag = flag.String("replay", "", "replay a recorded flight file headless and exit, instead of starting the UI")
+
+// recordStateMu guards recording/replaying/recorder/recordFile/replayStop:
+// startReplay's goroutine writes replaying from off the main event-loop
+// goroutine, which also reads it in onSensor and handleTouch, mirroring how
+// flightDataMu guards flightData.
+var (
+	recordStateMu sync.Mutex
+	recording     bool
+	replaying     bool
+	recorder      *flightrec.Recorder
+	recordFile    *os.File
+	replayStop    chan struct{}
+)
+
+func isRecording() bool {
+	recordStateMu.Lock()
+	defer recordStateMu.Unlock()
+	return recording
+}
+
+func isReplaying() bool {
+	recordStateMu.Lock()
+	defer recordStateMu.Unlock()
+	return replaying
+}
+
+func setReplaying(v bool) {
+	recordStateMu.Lock()
+	replaying = v
+	recordStateMu.Unlock()
+}
+
+func recordStick(stick tello.StickMessage) {
+	recordStateMu.Lock()
+	rec, on := recorder, recording
+	recordStateMu.Unlock()
+	if !on || rec == nil {
+		return
+	}
+	if err := rec.Record(velocity.x, velocity.y, yawVelocity, velocity.z, stick, getFlightData()); err != nil {
+		log.Print(err)
+	}
+}
+
+func toggleRecording() {
+	if isRecording() {
+		stopRecording()
+		return
+	}
+	startRecording(recordPath)
+}
+
+func startRecording(path string) {
+	rec, f, err := flightrec.CreateFile(path)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	recordStateMu.Lock()
+	recorder, recordFile, recording = rec, f, true
+	recordStateMu.Unlock()
+}
+
+func stopRecording() {
+	recordStateMu.Lock()
+	recording = false
+	f := recordFile
+	recordFile, recorder = nil, nil
+	recordStateMu.Unlock()
+	if f != nil {
+		f.Close()
+	}
+}
+
+func toggleReplay() {
+	if isReplaying() {
+		stopReplay()
+		return
+	}
+	startReplay(recordPath)
+}
+
+// startReplay plays a recorded file back through drone.UpdateSticks on its
+// own goroutine; handleTouch and onSensor suppress real input for as long
+// as isReplaying reports true.
+func startReplay(path string) {
+	player, f, err := flightrec.OpenFile(path)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	stop := make(chan struct{})
+	recordStateMu.Lock()
+	replaying, replayStop = true, stop
+	recordStateMu.Unlock()
+	go func() {
+		defer f.Close()
+		player.Replay(stop, func(rec flightrec.Record) {
+			drone.UpdateSticks(tello.StickMessage{Rx: rec.Rx, Ry: rec.Ry, Lx: rec.Lx, Ly: rec.Ly})
+		})
+		clearReplayingIfCurrent(stop)
+	}()
+}
+
+// clearReplayingIfCurrent clears replaying only if stop is still
+// replayStop, i.e. this goroutine's run wasn't itself superseded by a
+// later stopReplay/startReplay pair. Without this check, a finishing
+// goroutine from a stopped-and-immediately-restarted run could clear
+// replaying out from under the run that replaced it.
+func clearReplayingIfCurrent(stop chan struct{}) {
+	recordStateMu.Lock()
+	defer recordStateMu.Unlock()
+	if replayStop == stop {
+		replaying = false
+	}
+}
+
+func stopReplay() {
+	recordStateMu.Lock()
+	stop := replayStop
+	recordStateMu.Unlock()
+	if stop != nil {
+		close(stop)
+	}
+	setReplaying(false)
+}
+
+// replayHeadless drives a recorded file through telloParam without the
+// mobile UI, as a regression test that stick-value conversion still
+// matches what was recorded.
+func replayHeadless(path string) {
+	player, f, err := flightrec.OpenFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	mismatches := 0
+	err = player.Replay(nil, func(rec flightrec.Record) {
+		rx, ry := telloParam(rec.Vx), telloParam(rec.Vy)
+		lx, ly := telloParam(rec.Yaw), telloParam(rec.Vz)
+		if rx != rec.Rx || ry != rec.Ry || lx != rec.Lx || ly != rec.Ly {
+			mismatches++
+			log.Printf("stick mismatch at %dns: got (%d,%d,%d,%d), recorded (%d,%d,%d,%d)",
+				rec.TimestampNanos, rx, ry, lx, ly, rec.Rx, rec.Ry, rec.Lx, rec.Ly)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("replayed %s: %d mismatch(es)", path, mismatches)
+}
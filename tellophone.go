@@ -2,8 +2,12 @@ package main
 
 import (
 	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"math"
+	"os/exec"
 	"time"
 
 	"github.com/SMerrony/tello"
@@ -34,8 +38,40 @@ void main() {
 	gl_FragColor = vec4(vec3(grayLevel), 1.0);
 }`
 
+const videoVertShader = `#version 100
+
+attribute vec4 videoPosition;
+attribute vec2 videoTexCoord;
+varying vec2 vTexCoord;
+
+void main() {
+	vTexCoord = videoTexCoord;
+	gl_Position = videoPosition;
+}`
+
+const videoFragShader = `#version 100
+
+uniform sampler2D videoTex;
+uniform mediump float videoAlpha;
+varying vec2 vTexCoord;
+
+void main() {
+	gl_FragColor = vec4(texture2D(videoTex, vTexCoord).rgb, videoAlpha);
+}`
+
+// videoFlag opts into the video HUD background. It defaults to off since it
+// shells out to ffmpeg (see decodeVideo) and not every build/run environment
+// has that on PATH.
+var videoFlag = flag.Bool("video", false, "enable the video HUD background (decodes via an ffmpeg subprocess)")
+
 type coord struct{ x, y, z float64 }
 
+// videoFrame is a decoded RGBA frame ready for upload to a GL texture.
+type videoFrame struct {
+	w, h int
+	rgba []byte
+}
+
 var (
 	appSize size.Event
 
@@ -55,9 +91,39 @@ var (
 		0.0, -0.5, 0.0,
 		0.0, 0.5, 0.0,
 	)
+
+	videoProgram     gl.Program
+	videoPosition    gl.Attrib
+	videoTexCoord    gl.Attrib
+	videoTexUniform  gl.Uniform
+	videoAlphaUnif   gl.Uniform
+	videoPosBuf      gl.Buffer
+	videoTexCoordBuf gl.Buffer
+	videoTex         gl.Texture
+	videoFrameReady  bool
+	videoFrames      chan videoFrame
+	videoStop        chan struct{}
+
+	videoQuadVerts = f32.Bytes(binary.LittleEndian,
+		-1.0, -1.0, 0.0,
+		1.0, -1.0, 0.0,
+		-1.0, 1.0, 0.0,
+		1.0, 1.0, 0.0,
+	)
+	videoQuadTexCoords = f32.Bytes(binary.LittleEndian,
+		0.0, 1.0,
+		1.0, 1.0,
+		0.0, 0.0,
+		1.0, 0.0,
+	)
 )
 
 func main() {
+	flag.Parse()
+	if *replayFlag != "" {
+		replayHeadless(*replayFlag)
+		return
+	}
 	initDrone()
 	app.Main(appMain)
 }
@@ -94,17 +160,11 @@ func appMain(ap app.App) {
 }
 
 func onTouch(evt touch.Event) {
-	if evt.Type == touch.TypeEnd || appSize.WidthPx < 2 || appSize.HeightPx < 2 {
-		velocity.z, yawVelocity = 0.0, 0.0
-	} else {
-		yawVelocity = 2.0*float64(evt.X)/float64(appSize.WidthPx-1) - 1.0
-		velocity.z = -(2.0*float64(evt.Y)/float64(appSize.HeightPx-1) - 1.0)
-	}
-	updateCtrl()
+	handleTouch(evt)
 }
 
 func onSensor(evt sensor.Event) {
-	if evt.Sensor != sensor.Accelerometer {
+	if evt.Sensor != sensor.Accelerometer || isReplaying() {
 		return
 	}
 	accel := coord{evt.Data[0], evt.Data[1], evt.Data[2]}
@@ -120,11 +180,9 @@ func onSensor(evt sensor.Event) {
 	if hyp := math.Sqrt(accel.y*accel.y + accel.z*accel.z); hyp != 0.0 {
 		pitch = math.Atan(accel.x / hyp)
 	}
-	velocity.x = roll / (0.5 * math.Pi)
-	velocity.y = -pitch / (0.5 * math.Pi)
+	accelCtl.roll = roll / (0.5 * math.Pi)
+	accelCtl.pitch = -pitch / (0.5 * math.Pi)
 	updateCtrl()
-
-	flightData = drone.GetFlightData()
 }
 
 func onStart() {
@@ -145,10 +203,22 @@ func onStart() {
 	glctx.BufferData(gl.ARRAY_BUFFER, lineVerts, gl.STATIC_DRAW)
 	position = glctx.GetAttribLocation(program, "position")
 	grayLevel = glctx.GetUniformLocation(program, "grayLevel")
+
+	if *videoFlag {
+		startVideo()
+	}
+	startHUD()
+	startTouch()
 }
 
 func onStop() {
 	resetCtrl()
+	// Unconditional: -video isn't the only way the stream gets started: the
+	// zoneVideo touch button can start it too (see touch.go), and stopVideo
+	// is nil-guarded so it's a no-op when nothing is running.
+	stopVideo()
+	stopHUD()
+	stopTouch()
 	drone.ControlDisconnect()
 	if err := sensor.Disable(sensor.Accelerometer); err != nil {
 		log.Println(err)
@@ -158,16 +228,35 @@ func onStop() {
 }
 
 func onPaint() {
-	if flightData.BatteryCritical {
+	fd := getFlightData()
+	if fd.BatteryCritical {
 		glctx.ClearColor(0.5, 0.0, 0.0, 0.0)
-	} else if flightData.BatteryLow {
+	} else if fd.BatteryLow {
 		glctx.ClearColor(0.5, 0.5, 0.0, 0.0)
-	} else if flightData.Flying {
+	} else if fd.Flying {
 		glctx.ClearColor(0.0, 0.25, 0.0, 0.0)
 	} else {
 		glctx.ClearColor(0.0, 0.0, 0.25, 0.0)
 	}
 	glctx.Clear(gl.COLOR_BUFFER_BIT)
+
+	select {
+	case frame := <-videoFrames:
+		glctx.BindTexture(gl.TEXTURE_2D, videoTex)
+		glctx.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, frame.w, frame.h, gl.RGBA, gl.UNSIGNED_BYTE, frame.rgba)
+		videoFrameReady = true
+	default:
+	}
+	if videoFrameReady {
+		drawVideo()
+	}
+
+	drawLines()
+	drawHUD()
+	drawJoysticks()
+}
+
+func drawLines() {
 	glctx.UseProgram(program)
 	glctx.BindBuffer(gl.ARRAY_BUFFER, vertBuf)
 	glctx.EnableVertexAttribArray(position)
@@ -181,6 +270,147 @@ func onPaint() {
 	glctx.DisableVertexAttribArray(position)
 }
 
+// drawVideo composites the most recently uploaded video frame as a
+// full-screen quad, blended so the battery-tint clear color still shows
+// through underneath.
+func drawVideo() {
+	glctx.Enable(gl.BLEND)
+	glctx.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	glctx.UseProgram(videoProgram)
+	glctx.ActiveTexture(gl.TEXTURE0)
+	glctx.BindTexture(gl.TEXTURE_2D, videoTex)
+	glctx.Uniform1i(videoTexUniform, 0)
+	glctx.Uniform1f(videoAlphaUnif, 0.92)
+	glctx.BindBuffer(gl.ARRAY_BUFFER, videoPosBuf)
+	glctx.EnableVertexAttribArray(videoPosition)
+	glctx.VertexAttribPointer(videoPosition, 3, gl.FLOAT, false, 0, 0)
+	glctx.BindBuffer(gl.ARRAY_BUFFER, videoTexCoordBuf)
+	glctx.EnableVertexAttribArray(videoTexCoord)
+	glctx.VertexAttribPointer(videoTexCoord, 2, gl.FLOAT, false, 0, 0)
+	glctx.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+	glctx.DisableVertexAttribArray(videoPosition)
+	glctx.DisableVertexAttribArray(videoTexCoord)
+	glctx.Disable(gl.BLEND)
+}
+
+// startVideo wires up the textured-quad shader pipeline and kicks off the
+// frame-decode goroutine so the GL thread never blocks on the network or
+// on decoding.
+func startVideo() {
+	if videoStop != nil {
+		return // already running
+	}
+	var err error
+	videoProgram, err = glutil.CreateProgram(glctx, videoVertShader, videoFragShader)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	videoPosBuf = glctx.CreateBuffer()
+	glctx.BindBuffer(gl.ARRAY_BUFFER, videoPosBuf)
+	glctx.BufferData(gl.ARRAY_BUFFER, videoQuadVerts, gl.STATIC_DRAW)
+	videoTexCoordBuf = glctx.CreateBuffer()
+	glctx.BindBuffer(gl.ARRAY_BUFFER, videoTexCoordBuf)
+	glctx.BufferData(gl.ARRAY_BUFFER, videoQuadTexCoords, gl.STATIC_DRAW)
+	videoPosition = glctx.GetAttribLocation(videoProgram, "videoPosition")
+	videoTexCoord = glctx.GetAttribLocation(videoProgram, "videoTexCoord")
+	videoTexUniform = glctx.GetUniformLocation(videoProgram, "videoTex")
+	videoAlphaUnif = glctx.GetUniformLocation(videoProgram, "videoAlpha")
+
+	videoTex = glctx.CreateTexture()
+	glctx.BindTexture(gl.TEXTURE_2D, videoTex)
+	glctx.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	glctx.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	glctx.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	glctx.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+
+	nalus, err := drone.VideoConnectDefault()
+	if err != nil {
+		log.Print(err)
+		glctx.DeleteProgram(videoProgram)
+		glctx.DeleteBuffer(videoPosBuf)
+		glctx.DeleteBuffer(videoTexCoordBuf)
+		glctx.DeleteTexture(videoTex)
+		return
+	}
+	videoFrames = make(chan videoFrame, 2)
+	videoStop = make(chan struct{})
+	go decodeVideo(nalus, videoFrames, videoStop)
+}
+
+func stopVideo() {
+	if videoStop == nil {
+		return // startVideo never got past program/stream setup
+	}
+	close(videoStop)
+	videoStop = nil
+	videoFrameReady = false
+	drone.VideoDisconnect()
+	glctx.DeleteProgram(videoProgram)
+	glctx.DeleteBuffer(videoPosBuf)
+	glctx.DeleteBuffer(videoTexCoordBuf)
+	glctx.DeleteTexture(videoTex)
+}
+
+const (
+	videoFrameW = 320
+	videoFrameH = 240
+)
+
+// decodeVideo turns the Tello's raw H.264 NAL stream into RGBA frames by
+// piping it through an ffmpeg subprocess (this tree has no Go-native H.264
+// decoder to link against). One goroutine feeds NAL units to ffmpeg's
+// stdin while decodeVideo itself blocks reading decoded frames off stdout,
+// so a slow or wedged ffmpeg only stalls this goroutine, never the GL
+// thread reading from out.
+func decodeVideo(nalus <-chan []byte, out chan<- videoFrame, stop <-chan struct{}) {
+	cmd := exec.Command("ffmpeg",
+		"-f", "h264", "-i", "pipe:0",
+		"-f", "rawvideo", "-pix_fmt", "rgba", "-s", fmt.Sprintf("%dx%d", videoFrameW, videoFrameH),
+		"-loglevel", "error", "pipe:1")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		log.Print(err)
+		return
+	}
+	go func() {
+		<-stop
+		cmd.Process.Kill()
+	}()
+	go func() {
+		defer stdin.Close()
+		for pkt := range nalus {
+			if _, err := stdin.Write(pkt); err != nil {
+				return
+			}
+		}
+	}()
+
+	frame := make([]byte, videoFrameW*videoFrameH*4)
+	for {
+		if _, err := io.ReadFull(stdout, frame); err != nil {
+			cmd.Wait()
+			return
+		}
+		select {
+		case out <- videoFrame{w: videoFrameW, h: videoFrameH, rgba: append([]byte(nil), frame...)}:
+		case <-stop:
+			cmd.Wait()
+			return
+		default:
+		}
+	}
+}
+
 func initDrone() {
 	if err := drone.ControlConnectDefault(); err != nil {
 		log.Println(err)
@@ -194,7 +424,7 @@ func resetCtrl() {
 
 func takeoffLand() {
 	resetCtrl()
-	if flightData.Flying {
+	if getFlightData().Flying {
 		drone.Land()
 	} else {
 		drone.TakeOff()
@@ -206,10 +436,13 @@ func telloParam(val float64) int16 {
 }
 
 func updateCtrl() {
-	drone.UpdateSticks(tello.StickMessage{
+	velocity.x, velocity.y, yawVelocity, velocity.z = activeController().PollAxes()
+	stick := tello.StickMessage{
 		Rx: telloParam(velocity.x),
 		Ry: telloParam(velocity.y),
 		Lx: telloParam(yawVelocity),
 		Ly: telloParam(velocity.z),
-	})
+	}
+	drone.UpdateSticks(stick)
+	recordStick(stick)
 }
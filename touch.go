@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"math"
+
+	"github.com/SMerrony/tello"
+	"golang.org/x/mobile/event/touch"
+	"golang.org/x/mobile/exp/f32"
+	"golang.org/x/mobile/gl"
+)
+
+// controlMode selects which Controller drives the sticks: device tilt, the
+// on-screen touch joysticks, or a gamepad.
+type controlMode int
+
+const (
+	modeTilt controlMode = iota
+	modeTouch
+	modeGamepad
+)
+
+var activeMode = modeTilt
+
+type zone int
+
+const (
+	zoneNone zone = iota
+	zoneLeftStick
+	zoneRightStick
+	zoneTakeoffLand
+	zoneFlip
+	zonePalmLand
+	zonePhoto
+	zoneVideo
+	zoneMode
+	zoneRecord
+	zoneReplay
+)
+
+var buttonZones = []zone{
+	zoneTakeoffLand, zoneFlip, zonePalmLand, zonePhoto, zoneVideo, zoneMode, zoneRecord, zoneReplay,
+}
+
+const stickZoneFrac = 0.3 // fraction of width given to each side joystick zone
+
+// buttonStripFrac bounds the button column to a band centered vertically on
+// the screen, covering this fraction of its height. Taps in the column above
+// or below the band fall through to zoneNone, which in tilt mode is
+// yaw+throttle input; a tap at the screen center lands on a button.
+const buttonStripFrac = 0.5
+
+type stick struct {
+	active           bool
+	originX, originY float64
+	x, y             float64 // normalized offset from origin, -1..1
+}
+
+var (
+	leftStick, rightStick stick
+	touchZones            = map[touch.Sequence]zone{}
+
+	// videoStreaming tracks zoneVideo's toggle state for the local ffmpeg
+	// HUD-decode pipeline (startVideo/stopVideo in tellophone.go). The
+	// tello package exposes no onboard-recording call for this tree to
+	// drive, so this button starts/stops local viewing only; it does not
+	// start or stop a recording on the drone itself.
+	videoStreaming bool
+
+	touchVertBuf gl.Buffer
+)
+
+const (
+	stickBaseRadiusPx  = 60.0
+	stickThumbRadiusPx = 20.0
+)
+
+func startTouch() {
+	touchVertBuf = glctx.CreateBuffer()
+}
+
+func stopTouch() {
+	leftStick, rightStick = stick{}, stick{}
+	touchZones = map[touch.Sequence]zone{}
+	glctx.DeleteBuffer(touchVertBuf)
+}
+
+// handleTouch tracks each finger by touch.Sequence so the left and right
+// joysticks and the button column can all be driven concurrently.
+func handleTouch(evt touch.Event) {
+	if appSize.WidthPx < 2 || appSize.HeightPx < 2 {
+		return
+	}
+	if isReplaying() {
+		if evt.Type == touch.TypeBegin && zoneFor(evt.X, evt.Y) == zoneReplay {
+			dispatchButton(zoneReplay)
+		}
+		return
+	}
+	switch evt.Type {
+	case touch.TypeBegin:
+		z := zoneFor(evt.X, evt.Y)
+		touchZones[evt.Sequence] = z
+		switch z {
+		case zoneLeftStick:
+			leftStick = stick{active: true, originX: float64(evt.X), originY: float64(evt.Y)}
+		case zoneRightStick:
+			rightStick = stick{active: true, originX: float64(evt.X), originY: float64(evt.Y)}
+		case zoneNone:
+			updateTiltTouch(evt)
+		default:
+			dispatchButton(z)
+		}
+	case touch.TypeMove:
+		z := touchZones[evt.Sequence]
+		updateStick(z, evt)
+		if z == zoneNone {
+			updateTiltTouch(evt)
+		}
+	case touch.TypeEnd:
+		switch touchZones[evt.Sequence] {
+		case zoneLeftStick:
+			leftStick = stick{}
+		case zoneRightStick:
+			rightStick = stick{}
+		case zoneNone:
+			resetTiltTouch()
+		}
+		delete(touchZones, evt.Sequence)
+	}
+	updateCtrl()
+}
+
+// updateTiltTouch preserves the original single-touch yaw+throttle mapping
+// (raw touch position, not a joystick offset) so tilt mode - the mode every
+// user starts in - still has a way to ascend/descend and turn instead of
+// only rolling/pitching.
+func updateTiltTouch(evt touch.Event) {
+	if activeMode != modeTilt {
+		return
+	}
+	accelCtl.yaw = 2.0*float64(evt.X)/float64(appSize.WidthPx-1) - 1.0
+	accelCtl.throttle = -(2.0*float64(evt.Y)/float64(appSize.HeightPx-1) - 1.0)
+}
+
+func resetTiltTouch() {
+	accelCtl.yaw, accelCtl.throttle = 0.0, 0.0
+}
+
+func zoneFor(x, y float32) zone {
+	w, h := float64(appSize.WidthPx), float64(appSize.HeightPx)
+	fx, fy := float64(x), float64(y)
+	if fx >= w*stickZoneFrac && fx <= w*(1-stickZoneFrac) {
+		return buttonZoneAt(fy, h)
+	}
+	if activeMode == modeTouch {
+		if fx < w*stickZoneFrac {
+			return zoneLeftStick
+		}
+		return zoneRightStick
+	}
+	return zoneNone
+}
+
+func buttonZoneAt(y, h float64) zone {
+	top := h * (1 - buttonStripFrac) / 2
+	bottom := h - top
+	if y < top || y >= bottom {
+		return zoneNone
+	}
+	row := int((y - top) / ((bottom - top) / float64(len(buttonZones))))
+	if row < 0 || row >= len(buttonZones) {
+		return zoneNone
+	}
+	return buttonZones[row]
+}
+
+func updateStick(z zone, evt touch.Event) {
+	var s *stick
+	switch z {
+	case zoneLeftStick:
+		s = &leftStick
+	case zoneRightStick:
+		s = &rightStick
+	default:
+		return
+	}
+	if !s.active {
+		return
+	}
+	dx := float64(evt.X) - s.originX
+	dy := float64(evt.Y) - s.originY
+	if mag := math.Hypot(dx, dy); mag > stickBaseRadiusPx {
+		dx *= stickBaseRadiusPx / mag
+		dy *= stickBaseRadiusPx / mag
+	}
+	s.x = dx / stickBaseRadiusPx
+	s.y = -dy / stickBaseRadiusPx
+}
+
+func dispatchButton(z zone) {
+	var err error
+	switch z {
+	case zoneTakeoffLand:
+		takeoffLand()
+	case zoneFlip:
+		drone.Flip(tello.FlipForward)
+	case zonePalmLand:
+		drone.PalmLand()
+	case zonePhoto:
+		err = drone.TakePicture()
+	case zoneVideo:
+		videoStreaming = !videoStreaming
+		// Route through startVideo/stopVideo rather than calling
+		// drone.VideoConnectDefault/VideoDisconnect directly: those own the
+		// -video HUD background's stream too (see tellophone.go), and both
+		// are now idempotent, so toggling this button can't orphan the
+		// NALU channel or tear down the HUD's feed out from under it.
+		if videoStreaming {
+			startVideo()
+		} else if !*videoFlag {
+			stopVideo()
+		}
+	case zoneMode:
+		toggleMode()
+	case zoneRecord:
+		toggleRecording()
+	case zoneReplay:
+		toggleReplay()
+	}
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// toggleMode cycles tilt -> touch -> gamepad -> tilt, but only if a gamepad
+// has ever reported an axis; no platform bridge calls gamepadCtl.SetAxis in
+// this tree yet, so by default the cycle stays tilt <-> touch and a user
+// tapping the mode button never lands in a mode with every axis pinned to
+// zero for no visible reason.
+func toggleMode() {
+	switch activeMode {
+	case modeTilt:
+		activeMode = modeTouch
+	case modeTouch:
+		if gamepadCtl.connected {
+			activeMode = modeGamepad
+		} else {
+			activeMode = modeTilt
+		}
+	default:
+		activeMode = modeTilt
+	}
+	leftStick, rightStick = stick{}, stick{}
+	resetCtrl()
+}
+
+// drawJoysticks renders the base and thumbstick of both touch joysticks
+// whenever touch mode is on, at fixed spots near the bottom corners, with
+// each thumbstick offset from its base by that stick's current deflection.
+func drawJoysticks() {
+	if activeMode != modeTouch || appSize.WidthPx < 2 || appSize.HeightPx < 2 {
+		return
+	}
+	w, h := float64(appSize.WidthPx), float64(appSize.HeightPx)
+	drawStick(w*stickZoneFrac*0.5, h*0.8, leftStick)
+	drawStick(w*(1-stickZoneFrac*0.5), h*0.8, rightStick)
+}
+
+func drawStick(cx, cy float64, s stick) {
+	drawCircleOutline(cx, cy, stickBaseRadiusPx)
+	drawCircleOutline(cx+s.x*stickBaseRadiusPx, cy-s.y*stickBaseRadiusPx, stickThumbRadiusPx)
+}
+
+func drawCircleOutline(cx, cy, r float64) {
+	const segments = 16
+	vals := make([]float32, 0, segments*3)
+	for i := 0; i < segments; i++ {
+		theta := 2 * math.Pi * float64(i) / float64(segments)
+		vals = append(vals, pxToNDCx(cx+r*math.Cos(theta)), pxToNDCy(cy+r*math.Sin(theta)), 0.0)
+	}
+	verts := f32.Bytes(binary.LittleEndian, vals...)
+	glctx.UseProgram(program)
+	glctx.BindBuffer(gl.ARRAY_BUFFER, touchVertBuf)
+	glctx.BufferData(gl.ARRAY_BUFFER, verts, gl.DYNAMIC_DRAW)
+	glctx.EnableVertexAttribArray(position)
+	glctx.VertexAttribPointer(position, 3, gl.FLOAT, false, 0, 0)
+	glctx.Uniform1f(grayLevel, 0.8)
+	glctx.DrawArrays(gl.LINE_LOOP, 0, segments)
+	glctx.DisableVertexAttribArray(position)
+}